@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/Microsoft/go-winio"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// pipeName is the named pipe the service listens on for control commands.
+const pipeName = `\\.\pipe\RebootSchedulerService`
+
+// pipeSecurityDescriptor restricts the control pipe to Administrators (BA)
+// and LocalSystem (SY), since anyone who can reach it can postpone, cancel,
+// or trigger a reboot.
+const pipeSecurityDescriptor = "D:P(A;;GA;;;BA)(A;;GA;;;SY)"
+
+// ipcRequest is the JSON command sent by `reboot.exe ctl`.
+type ipcRequest struct {
+	Cmd      string `json:"cmd"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// ipcResponse is the JSON reply written back to the client.
+type ipcResponse struct {
+	OK     bool             `json:"ok"`
+	Error  string           `json:"error,omitempty"`
+	Status *schedulerStatus `json:"status,omitempty"`
+}
+
+// serveIPC listens on the control pipe until done is closed, dispatching
+// status/reload/postpone/cancel/reboot-now commands from reboot.exe ctl.
+func serveIPC(done <-chan struct{}, elog *eventlog.Log) {
+	ln, err := winio.ListenPipe(pipeName, &winio.PipeConfig{SecurityDescriptor: pipeSecurityDescriptor})
+	if err != nil {
+		log.Printf("Failed to listen on control pipe: %v", err)
+		if elog != nil {
+			elog.Error(1, fmt.Sprintf("Failed to listen on control pipe: %v", err))
+		}
+		return
+	}
+	defer ln.Close()
+
+	go func() {
+		<-done
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-done:
+				return
+			default:
+				log.Printf("Control pipe accept error: %v", err)
+				return
+			}
+		}
+		go handleIPCConn(conn)
+	}
+}
+
+func handleIPCConn(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var req ipcRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		json.NewEncoder(conn).Encode(ipcResponse{OK: false, Error: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	json.NewEncoder(conn).Encode(dispatchIPC(req))
+}
+
+// dispatchIPC runs a single IPC command and returns the response to send
+// back to the client.
+func dispatchIPC(req ipcRequest) ipcResponse {
+	switch req.Cmd {
+	case "status":
+		st := getSchedulerStatus()
+		return ipcResponse{OK: true, Status: &st}
+	case "reload":
+		if err := reloadConfig(); err != nil {
+			return ipcResponse{OK: false, Error: err.Error()}
+		}
+		wakeScheduler(schedReschedule)
+		log.Println("Config reloaded via IPC.")
+		return ipcResponse{OK: true}
+	case "postpone":
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			return ipcResponse{OK: false, Error: fmt.Sprintf("invalid duration: %v", err)}
+		}
+		postponeReboot(d)
+		log.Printf("Reboot postponed by %s via IPC.", d)
+		return ipcResponse{OK: true}
+	case "cancel":
+		cancelReboot()
+		log.Println("Next scheduled reboot canceled via IPC.")
+		return ipcResponse{OK: true}
+	case "reboot-now":
+		rebootNow()
+		log.Println("Immediate reboot triggered via IPC.")
+		return ipcResponse{OK: true}
+	default:
+		return ipcResponse{OK: false, Error: fmt.Sprintf("unknown command: %q", req.Cmd)}
+	}
+}
+
+// ctl dials the control pipe, sends cmd (with an optional duration argument
+// for postpone), and prints the response. Used by `reboot.exe ctl <cmd>`.
+func ctl(cmd string, arg string) {
+	conn, err := winio.DialPipe(pipeName, nil)
+	if err != nil {
+		log.Fatalf("Failed to connect to %s: %v", serviceName, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req := ipcRequest{Cmd: cmd, Duration: arg}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		log.Fatalf("Failed to send command: %v", err)
+	}
+
+	var resp ipcResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		log.Fatalf("Failed to read response: %v", err)
+	}
+
+	if !resp.OK {
+		fmt.Printf("error: %s\n", resp.Error)
+		return
+	}
+	if resp.Status != nil {
+		fmt.Printf("next reboot: %s\nschedules: %v\nuptime: %s\n", resp.Status.NextReboot, resp.Status.Schedules, resp.Status.Uptime)
+		if resp.Status.PendingReboot {
+			fmt.Printf("pending reboot at: %s (%s)\n", resp.Status.PendingAt, resp.Status.PendingMessage)
+		}
+		return
+	}
+	fmt.Println("ok")
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// wtsapi32 holds the WTS (Windows Terminal Services) procedures used to
+// broadcast the reboot warning to logged-on users; golang.org/x/sys/windows
+// doesn't wrap wtsapi32.dll itself.
+var (
+	wtsapi32                 = windows.NewLazySystemDLL("wtsapi32.dll")
+	procWTSEnumerateSessions = wtsapi32.NewProc("WTSEnumerateSessionsW")
+	procWTSSendMessage       = wtsapi32.NewProc("WTSSendMessageW")
+	procWTSFreeMemory        = wtsapi32.NewProc("WTSFreeMemory")
+)
+
+// wtsCurrentServerHandle targets the local machine.
+const wtsCurrentServerHandle = 0
+
+// wtsActive is the WTS_CONNECTSTATE_CLASS value for a session with a user
+// actively logged on.
+const wtsActive = 0
+
+type wtsSessionInfo struct {
+	SessionID      uint32
+	WinStationName *uint16
+	State          uint32
+}
+
+// notifyLoggedOnUsers pops a message box titled "Scheduled reboot" on every
+// active session, giving lead time before the Windows shutdown countdown UI
+// takes over. Best-effort: failures are logged but never block the reboot.
+func notifyLoggedOnUsers(message string, lead time.Duration) {
+	var sessions *wtsSessionInfo
+	var count uint32
+
+	ret, _, err := procWTSEnumerateSessions.Call(
+		uintptr(wtsCurrentServerHandle),
+		0,
+		1,
+		uintptr(unsafe.Pointer(&sessions)),
+		uintptr(unsafe.Pointer(&count)),
+	)
+	if ret == 0 {
+		log.Printf("Failed to enumerate sessions for reboot warning: %v", err)
+		return
+	}
+	defer procWTSFreeMemory.Call(uintptr(unsafe.Pointer(sessions)))
+
+	const title = "Scheduled reboot"
+	titlePtr, err := windows.UTF16PtrFromString(title)
+	if err != nil {
+		log.Printf("Failed to encode warning title: %v", err)
+		return
+	}
+	bodyPtr, err := windows.UTF16PtrFromString(message)
+	if err != nil {
+		log.Printf("Failed to encode warning message: %v", err)
+		return
+	}
+
+	for _, s := range unsafe.Slice(sessions, count) {
+		if s.State != wtsActive {
+			continue
+		}
+		var response uint32
+		ret, _, err := procWTSSendMessage.Call(
+			uintptr(wtsCurrentServerHandle),
+			uintptr(s.SessionID),
+			uintptr(unsafe.Pointer(titlePtr)),
+			uintptr(len(title)*2),
+			uintptr(unsafe.Pointer(bodyPtr)),
+			uintptr(len(message)*2),
+			0, // MB_OK
+			uintptr(lead/time.Second),
+			uintptr(unsafe.Pointer(&response)),
+			0, // bWait = false, don't block the reboot on the dialog
+		)
+		if ret == 0 {
+			log.Printf("Failed to send reboot warning to session %d: %v", s.SessionID, err)
+		}
+	}
+}
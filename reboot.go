@@ -1,29 +1,90 @@
 package main
 
 import (
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/robfig/cron/v3"
 	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/debug"
 	"golang.org/x/sys/windows/svc/eventlog"
 	"golang.org/x/sys/windows/svc/mgr"
 	"gopkg.in/yaml.v2"
 )
 
+// cronParser parses the standard 5-field cron expressions used by the
+// `schedules` config entries, e.g. "0 23 * * SUN".
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+
 var exePath = "C:/"
 
+// dryRun stubs out the actual shutdown invocation so a schedule can be
+// validated via the debug harness without rebooting the machine.
+var dryRun bool
+
+// debugMode indicates Execute is running under the svc/debug harness
+// (see runDebug), so it should also log to stdout.
+var debugMode bool
+
+// rebootElog is the event log handle opened in Execute, used by reboot() to
+// report the pending-reboot warning and any abort so they show up in the
+// Windows event log, not just reboot_log.txt.
+var rebootElog *eventlog.Log
+
+// Recovery holds the SCM recovery actions programmed on the service at
+// install time, letting operators tune reboot-scheduler resilience without
+// recompiling.
+type Recovery struct {
+	// RestartDelay is how long the SCM waits before restarting the service
+	// after a failure, e.g. "20s".
+	RestartDelay string `yaml:"restart_delay"`
+	// ResetPeriod is how long the service must run without failing before
+	// the SCM resets its failure count, e.g. "24h".
+	ResetPeriod string `yaml:"reset_period"`
+	// Actions is the ordered list of actions to take on the 1st, 2nd, 3rd...
+	// failure. Valid values are "restart", "reboot", and "none". The last
+	// entry is reused for any failure beyond the list's length.
+	Actions []string `yaml:"actions"`
+}
+
 // Config struct to hold the YAML configuration
 var config struct {
-	AfterDays int    `yaml:"after_days"`
-	At        string `yaml:"at"`
+	// Schedules is a list of cron-style expressions (standard 5-field,
+	// supporting day-of-week names), e.g. "0 23 * * SUN" for every Sunday at
+	// 23:00. The next reboot fires at whichever entry occurs soonest.
+	Schedules []string `yaml:"schedules"`
+	Recovery  Recovery `yaml:"recovery"`
+	// WarnBefore is how long before a reboot logged-on users are warned,
+	// e.g. "10m". Also used as the Windows shutdown countdown so its
+	// built-in UI gives users the same lead time to save work or abort.
+	WarnBefore string `yaml:"warn_before"`
+	// WarnMessage is shown in the WTSSendMessage popup and passed to
+	// `shutdown /c`.
+	WarnMessage string `yaml:"warn_message"`
+	// AllowAbort gives users the full warn_before countdown in which to
+	// abort with `shutdown /a`, after which an abort is logged. When false,
+	// the countdown is a short fixed 10-second grace period instead of the
+	// full warn_before window.
+	AllowAbort bool `yaml:"allow_abort"`
 }
 
 var serviceName = "RebootSchedulerService"
 
+// configMu guards config: reloadConfig (called from the IPC goroutine) and
+// the scheduler goroutine's reads of it race otherwise.
+var configMu sync.Mutex
+
+func configPath() string {
+	return filepath.Join(exePath, "config.yaml")
+}
+
 func loadConfig() {
 
 	logFilePath := filepath.Join(exePath + "reboot_log.txt")
@@ -31,53 +92,282 @@ func loadConfig() {
 	if err != nil {
 		log.Fatalf("Failed to open log file: %v", err)
 	}
-	defer logFile.Close()
+	// Left open deliberately: log.SetOutput below keeps writing to logFile
+	// for the rest of the process's life, so closing it here (e.g. via
+	// defer) would silently break logging to reboot_log.txt the moment
+	// loadConfig returns.
 
 	multiWriter := io.MultiWriter(os.Stdout, logFile)
 	log.SetOutput(multiWriter)
 
-	configPath := filepath.Join(exePath, "config.yaml")
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		defaultConfig := []byte("after_days: 300\nat: \"23:50\"")
-		err = os.WriteFile(configPath, defaultConfig, 0644)
+	if _, err := os.Stat(configPath()); os.IsNotExist(err) {
+		defaultConfig := []byte("schedules:\n" +
+			"  - \"0 23 * * SUN\"\n" +
+			"recovery:\n" +
+			"  restart_delay: \"20s\"\n" +
+			"  reset_period: \"24h\"\n" +
+			"  actions: [restart, restart, none]\n" +
+			"warn_before: \"10m\"\n" +
+			"warn_message: \"This system will reboot automatically for scheduled maintenance.\"\n" +
+			"allow_abort: true\n")
+		err = os.WriteFile(configPath(), defaultConfig, 0644)
 		if err != nil {
 			log.Fatalf("Failed to create default config file: %v", err)
 		}
 		log.Println("Default config.yaml created.")
 	}
 
-	data, err := os.ReadFile(configPath)
-	if err != nil {
-		log.Fatalf("Failed to read config file: %v", err)
+	if err := reloadConfig(); err != nil {
+		log.Fatalf("Failed to load config file: %v", err)
 	}
+}
 
-	err = yaml.Unmarshal(data, &config)
+// reloadConfig rereads and reparses config.yaml into the global config,
+// returning an error instead of exiting so a bad edit doesn't kill the
+// service once it's already running.
+func reloadConfig() error {
+	data, err := os.ReadFile(configPath())
 	if err != nil {
-		log.Fatalf("Failed to parse config file: %v", err)
+		return err
+	}
+
+	var parsed struct {
+		Schedules   []string `yaml:"schedules"`
+		Recovery    Recovery `yaml:"recovery"`
+		WarnBefore  string   `yaml:"warn_before"`
+		WarnMessage string   `yaml:"warn_message"`
+		AllowAbort  bool     `yaml:"allow_abort"`
+	}
+	if err := yaml.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+
+	if _, err := parseSchedules(parsed.Schedules); err != nil {
+		return err
+	}
+
+	configMu.Lock()
+	config.Schedules = parsed.Schedules
+	config.Recovery = parsed.Recovery
+	config.WarnBefore = parsed.WarnBefore
+	config.WarnMessage = parsed.WarnMessage
+	config.AllowAbort = parsed.AllowAbort
+	configMu.Unlock()
+	return nil
+}
+
+// getConfigSchedules returns the current (unparsed) schedule specs, read
+// under the config lock so callers never see a torn read.
+func getConfigSchedules() []string {
+	configMu.Lock()
+	defer configMu.Unlock()
+	return config.Schedules
+}
+
+// getWarnSettings returns the current user-warning settings under the
+// config lock.
+func getWarnSettings() (warnBefore, warnMessage string, allowAbort bool) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	return config.WarnBefore, config.WarnMessage, config.AllowAbort
+}
+
+// parseSchedules parses each cron-style entry in specs.
+func parseSchedules(specs []string) ([]cron.Schedule, error) {
+	schedules := make([]cron.Schedule, len(specs))
+	for i, spec := range specs {
+		sched, err := cronParser.Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		schedules[i] = sched
+	}
+	return schedules, nil
+}
+
+// nextFireTime returns the soonest next occurrence among schedules, after
+// from.
+// nextFireTime returns false if schedules is empty, since the zero
+// time.Time it would otherwise return is already in the past and would
+// make the scheduler fire immediately in a loop.
+func nextFireTime(schedules []cron.Schedule, from time.Time) (time.Time, bool) {
+	var next time.Time
+	for _, sched := range schedules {
+		candidate := sched.Next(from)
+		if candidate.IsZero() {
+			// cron returns the zero time for a schedule that never fires.
+			continue
+		}
+		if next.IsZero() || candidate.Before(next) {
+			next = candidate
+		}
 	}
+	return next, !next.IsZero()
 }
 
-// Calculate sleep duration until the next reboot time
-func calculateSleepDuration() time.Duration {
-	now := time.Now()
-	restartTime, err := time.Parse("15:04", config.At)
+// configModTime returns config.yaml's modification time, or the zero value
+// if it can't be stat'd.
+func configModTime() time.Time {
+	info, err := os.Stat(configPath())
 	if err != nil {
-		log.Fatalf("Failed to parse time: %v", err)
+		return time.Time{}
 	}
+	return info.ModTime()
+}
+
+// configCheckInterval is how often the scheduler checks config.yaml for
+// changes to re-arm the timer without a service restart.
+const configCheckInterval = 30 * time.Second
+
+// schedState holds the scheduler state that the IPC control channel needs to
+// inspect or mutate from outside the scheduler goroutine.
+var schedState = struct {
+	mu             sync.Mutex
+	nextReboot     time.Time
+	overrideNext   time.Time
+	skipNext       bool
+	startTime      time.Time
+	pendingReboot  bool
+	pendingAt      time.Time
+	pendingMessage string
+}{}
+
+// schedReschedule wakes the scheduler goroutine so it immediately
+// recomputes the next fire time, e.g. after a postpone or config reload.
+var schedReschedule = make(chan struct{}, 1)
+
+// schedRebootNow triggers an immediate reboot, bypassing the schedule.
+var schedRebootNow = make(chan struct{}, 1)
+
+func wakeScheduler(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// schedulerStatus is a snapshot of the scheduler state for the IPC status
+// command.
+type schedulerStatus struct {
+	NextReboot     string   `json:"next_reboot"`
+	Schedules      []string `json:"schedules"`
+	Uptime         string   `json:"uptime"`
+	PendingReboot  bool     `json:"pending_reboot"`
+	PendingAt      string   `json:"pending_at,omitempty"`
+	PendingMessage string   `json:"pending_message,omitempty"`
+}
+
+func getSchedulerStatus() schedulerStatus {
+	schedules := getConfigSchedules()
+	schedState.mu.Lock()
+	defer schedState.mu.Unlock()
+	nextReboot := "none scheduled"
+	if !schedState.nextReboot.IsZero() {
+		nextReboot = schedState.nextReboot.Format("2006-01-02 15:04:05")
+	}
+	st := schedulerStatus{
+		NextReboot:    nextReboot,
+		Schedules:     schedules,
+		Uptime:        time.Since(schedState.startTime).Round(time.Second).String(),
+		PendingReboot: schedState.pendingReboot,
+	}
+	if schedState.pendingReboot {
+		st.PendingAt = schedState.pendingAt.Format("2006-01-02 15:04:05")
+		st.PendingMessage = schedState.pendingMessage
+	}
+	return st
+}
+
+// postponeReboot pushes the next reboot out by d.
+func postponeReboot(d time.Duration) {
+	schedState.mu.Lock()
+	base := schedState.nextReboot
+	if base.IsZero() || base.Before(time.Now()) {
+		base = time.Now()
+	}
+	schedState.overrideNext = base.Add(d)
+	schedState.mu.Unlock()
+	wakeScheduler(schedReschedule)
+}
 
-	restartDateTime := time.Date(now.Year(), now.Month(), now.Day()+config.AfterDays, restartTime.Hour(), restartTime.Minute(), 0, 0, now.Location())
-	return restartDateTime.Sub(now)
+// cancelReboot skips the next scheduled reboot; the scheduler then computes
+// the occurrence after it.
+func cancelReboot() {
+	schedState.mu.Lock()
+	schedState.skipNext = true
+	schedState.mu.Unlock()
 }
 
-// Initiate system reboot
+// rebootNow triggers an immediate reboot outside of the schedule.
+func rebootNow() {
+	wakeScheduler(schedRebootNow)
+}
+
+// defaultWarnMessage is used when warn_message is left blank in config.yaml.
+const defaultWarnMessage = "This system will reboot automatically for scheduled maintenance."
+
+// Initiate system reboot: warn logged-on users, then hand off to Windows'
+// own shutdown countdown, which lasts the full warn_before window (time to
+// abort with `shutdown /a`) if allow_abort is set and 10 seconds otherwise.
 func reboot() {
 	log.Println("Rebooting system...")
-	cmd := exec.Command("shutdown", "/r", "/t", "10")
-	err := cmd.Run()
+	if dryRun {
+		log.Println("Dry run: not executing shutdown command.")
+		return
+	}
+
+	warnBeforeStr, message, allowAbort := getWarnSettings()
+	if message == "" {
+		message = defaultWarnMessage
+	}
+
+	warnBefore, err := time.ParseDuration(warnBeforeStr)
 	if err != nil {
+		warnBefore = 0
+	}
+
+	seconds := int(warnBefore.Seconds())
+	if !allowAbort {
+		seconds = 10
+	}
+
+	notifyLoggedOnUsers(message, warnBefore)
+
+	schedState.mu.Lock()
+	schedState.pendingReboot = true
+	schedState.pendingAt = time.Now().Add(time.Duration(seconds) * time.Second)
+	schedState.pendingMessage = message
+	schedState.mu.Unlock()
+
+	if rebootElog != nil {
+		rebootElog.Info(1, fmt.Sprintf("Reboot pending in %ds: %s", seconds, message))
+	}
+
+	cmd := exec.Command("shutdown", "/r", "/t", strconv.Itoa(seconds), "/c", message)
+	if err := cmd.Run(); err != nil {
 		log.Fatalf("Failed to execute shutdown command: %v", err)
 	}
-	log.Println("System reboot initiated successfully.")
+	log.Printf("System reboot scheduled in %ds.", seconds)
+
+	if allowAbort {
+		// Give Windows' own countdown (plus a short grace period) time to
+		// either reboot the machine or be aborted via `shutdown /a`. If the
+		// process is still running afterwards, the reboot was aborted.
+		time.Sleep(time.Duration(seconds)*time.Second + 5*time.Second)
+		schedState.mu.Lock()
+		aborted := schedState.pendingReboot
+		schedState.mu.Unlock()
+		if aborted {
+			log.Println("Reboot window elapsed without restarting; it was likely aborted. Resuming normal schedule.")
+			if rebootElog != nil {
+				rebootElog.Warning(1, "Scheduled reboot was aborted; resuming normal schedule.")
+			}
+		}
+	}
+
+	schedState.mu.Lock()
+	schedState.pendingReboot = false
+	schedState.mu.Unlock()
 }
 
 // Windows service struct
@@ -95,31 +385,144 @@ func (s *RebootService) Execute(args []string, req <-chan svc.ChangeRequest, sta
 	}
 	defer logFile.Close()
 
-	// Set up logging to file
-	multiWriter := io.MultiWriter(logFile)
-	log.SetOutput(multiWriter)
+	// Set up logging to file, plus stdout when running under the debug
+	// harness so operators can watch the service loop from the console.
+	writers := []io.Writer{logFile}
+	if debugMode {
+		writers = append(writers, os.Stdout)
+	}
+	log.SetOutput(io.MultiWriter(writers...))
 
 	// Notify SCM that the service is starting
 	status <- svc.Status{State: svc.StartPending}
 
 	log.Println("Service is starting.")
 
+	// Open the event log so config parse errors can be reported without
+	// killing the service.
+	elog, err := eventlog.Open(serviceName)
+	if err != nil {
+		log.Printf("Failed to open event log: %v", err)
+		elog = nil
+	} else {
+		defer elog.Close()
+	}
+	rebootElog = elog
+
 	// Load configuration
 	loadConfig()
+	schedState.startTime = time.Now()
 
-	// Start service logic
+	// Start the named-pipe IPC control channel so operators can inspect and
+	// control the service while it's running.
 	done := make(chan struct{})
+	go serveIPC(done, elog)
+
+	// Start the scheduler: compute the next fire time from all configured
+	// schedules, sleep until it arrives, and watch config.yaml for changes
+	// so the schedule can be re-armed without a service restart.
 	go func() {
-		sleepDuration := calculateSleepDuration()
-		log.Printf("System will reboot at: %s", time.Now().Add(sleepDuration).Format("2006-01-02 15:04:05"))
+		schedules, err := parseSchedules(getConfigSchedules())
+		if err != nil {
+			log.Printf("Invalid schedules in config.yaml: %v", err)
+			if elog != nil {
+				elog.Error(1, fmt.Sprintf("Invalid schedules in config.yaml: %v", err))
+			}
+			return
+		}
+		lastMod := configModTime()
+
+		for {
+			next, ok := nextFireTime(schedules, time.Now())
+			schedState.mu.Lock()
+			if !schedState.overrideNext.IsZero() {
+				next = schedState.overrideNext
+				ok = true
+				schedState.overrideNext = time.Time{}
+			}
+			if ok {
+				schedState.nextReboot = next
+			} else {
+				schedState.nextReboot = time.Time{}
+			}
+			schedState.mu.Unlock()
+
+			// timerC stays nil (and so is never selected) when there's
+			// nothing scheduled, instead of firing immediately on a zero
+			// time.Time and reboot-looping.
+			var timer *time.Timer
+			var timerC <-chan time.Time
+			if ok {
+				log.Printf("Next reboot scheduled for: %s", next.Format("2006-01-02 15:04:05"))
+				timer = time.NewTimer(time.Until(next))
+				timerC = timer.C
+			} else {
+				log.Println("No schedules configured; waiting for config.yaml changes or an IPC command.")
+			}
 
-		// Wait until the reboot time or service stop request
-		timer := time.NewTimer(sleepDuration)
-		select {
-		case <-timer.C:
-			reboot()
-		case <-done:
-			timer.Stop()
+			checkTicker := time.NewTicker(configCheckInterval)
+
+		wait:
+			for {
+				select {
+				case <-timerC:
+					schedState.mu.Lock()
+					skip := schedState.skipNext
+					schedState.skipNext = false
+					schedState.mu.Unlock()
+					if skip {
+						log.Println("Scheduled reboot canceled via IPC; computing next occurrence.")
+					} else {
+						reboot()
+					}
+					break wait
+				case <-schedRebootNow:
+					reboot()
+					break wait
+				case <-schedReschedule:
+					newSchedules, err := parseSchedules(getConfigSchedules())
+					if err != nil {
+						// config was already validated on reload; guard anyway.
+						log.Printf("Failed to parse schedules on reschedule: %v", err)
+					} else {
+						schedules = newSchedules
+					}
+					log.Println("Reschedule requested; recomputing next fire time.")
+					break wait
+				case <-checkTicker.C:
+					mtime := configModTime()
+					if mtime.Equal(lastMod) {
+						continue
+					}
+					lastMod = mtime
+					if err := reloadConfig(); err != nil {
+						log.Printf("Failed to reload config.yaml: %v", err)
+						if elog != nil {
+							elog.Error(1, fmt.Sprintf("Failed to reload config.yaml: %v", err))
+						}
+						continue
+					}
+					newSchedules, err := parseSchedules(getConfigSchedules())
+					if err != nil {
+						// reloadConfig already validates schedules, but guard anyway.
+						log.Printf("Failed to parse reloaded schedules: %v", err)
+						continue
+					}
+					schedules = newSchedules
+					log.Println("config.yaml changed; rescheduling.")
+					break wait
+				case <-done:
+					if timer != nil {
+						timer.Stop()
+					}
+					checkTicker.Stop()
+					return
+				}
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			checkTicker.Stop()
 		}
 	}()
 
@@ -143,11 +546,58 @@ loop:
 	}
 
 	// Notify SCM that the service is stopping
+	close(done)
 	status <- svc.Status{State: svc.StopPending}
 	log.Println("Service is stopping.")
 	return false, 0
 }
 
+// recoveryActionType maps a config action name to the SCM recovery action
+// type (one of mgr.NoAction, mgr.ComputerReboot, mgr.ServiceRestart),
+// defaulting to no-op for anything unrecognized.
+func recoveryActionType(action string) int {
+	switch action {
+	case "restart":
+		return mgr.ServiceRestart
+	case "reboot":
+		return mgr.ComputerReboot
+	default:
+		return mgr.NoAction
+	}
+}
+
+// configureRecoveryActions programs the SCM recovery actions on s from the
+// config's recovery section, so the service auto-restarts after a crash the
+// same way cloudflared's Windows service does.
+func configureRecoveryActions(s *mgr.Service, r Recovery) error {
+	if len(r.Actions) == 0 {
+		return nil
+	}
+
+	delay, err := time.ParseDuration(r.RestartDelay)
+	if err != nil {
+		delay = 20 * time.Second
+	}
+
+	resetPeriod, err := time.ParseDuration(r.ResetPeriod)
+	if err != nil {
+		resetPeriod = 24 * time.Hour
+	}
+
+	actions := make([]mgr.RecoveryAction, len(r.Actions))
+	for i, a := range r.Actions {
+		actions[i] = mgr.RecoveryAction{Type: recoveryActionType(a), Delay: delay}
+	}
+
+	if err := s.SetRecoveryActions(actions, uint32(resetPeriod.Seconds())); err != nil {
+		return err
+	}
+
+	// Also run the recovery actions on non-crash failures (e.g. the process
+	// exiting with a non-zero code), not just crashes.
+	return s.SetRecoveryActionsOnNonCrashFailures(true)
+}
+
 // Install and start the service
 func installService() {
 	exePath, err := os.Executable()
@@ -155,6 +605,8 @@ func installService() {
 		log.Fatalf("Failed to get executable path: %v", err)
 	}
 
+	loadConfig()
+
 	m, err := mgr.Connect()
 	if err != nil {
 		log.Fatalf("Failed to connect to service manager: %v", err)
@@ -185,6 +637,10 @@ func installService() {
 		log.Fatalf("Failed to set up event log source: %v", err)
 	}
 
+	if err := configureRecoveryActions(s, config.Recovery); err != nil {
+		log.Printf("Failed to configure recovery actions: %v", err)
+	}
+
 	log.Println("Service installed successfully.")
 }
 
@@ -215,16 +671,55 @@ func uninstallService() {
 	log.Println("Service uninstalled successfully.")
 }
 
-// Main function to install, uninstall, or run the service
+// runDebug runs the service under the svc/debug harness so developers and
+// admins can exercise the full service loop from a console without
+// installing the service. The harness turns Ctrl+C into a Stop request;
+// Shutdown and Interrogate requests cannot be sent from the console.
+func runDebug() {
+	debugMode = true
+	log.SetOutput(os.Stdout)
+	log.Println("Running in debug mode. Press Ctrl+C to send a Stop request and exit.")
+	if dryRun {
+		log.Println("Dry run enabled: the shutdown command will not be executed.")
+	}
+	err := debug.Run(serviceName, &RebootService{})
+	if err != nil {
+		log.Fatalf("Debug run failed: %v", err)
+	}
+}
+
+// Main function to install, uninstall, debug, or run the service
 func main() {
-	if len(os.Args) > 1 {
-		switch os.Args[1] {
+	var cmdArgs []string
+	for _, arg := range os.Args[1:] {
+		if arg == "--dry-run" {
+			dryRun = true
+			continue
+		}
+		cmdArgs = append(cmdArgs, arg)
+	}
+
+	if len(cmdArgs) > 0 {
+		switch cmdArgs[0] {
 		case "install":
 			installService()
 			return
 		case "uninstall":
 			uninstallService()
 			return
+		case "debug":
+			runDebug()
+			return
+		case "ctl":
+			if len(cmdArgs) < 2 {
+				log.Fatalf("Usage: reboot.exe ctl <status|reload|postpone <duration>|cancel|reboot-now>")
+			}
+			var arg string
+			if cmdArgs[1] == "postpone" && len(cmdArgs) > 2 {
+				arg = cmdArgs[2]
+			}
+			ctl(cmdArgs[1], arg)
+			return
 		}
 	}
 
@@ -236,7 +731,9 @@ func main() {
 
 	if interactive {
 		log.Println("This program should be run as a Windows service.")
-		log.Println("Use 'install' to install the service and 'uninstall' to remove it.")
+		log.Println("Use 'install' to install the service, 'uninstall' to remove it, or 'debug' to run it interactively.")
+		runDebug()
+		return
 	}
 	// Run as a Windows service
 	err = svc.Run(serviceName, &RebootService{})
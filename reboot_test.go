@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseSchedulesValid(t *testing.T) {
+	specs := []string{"0 23 * * SUN", "30 3 1 * *"}
+	schedules, err := parseSchedules(specs)
+	if err != nil {
+		t.Fatalf("parseSchedules(%v) returned error: %v", specs, err)
+	}
+	if len(schedules) != len(specs) {
+		t.Fatalf("got %d schedules, want %d", len(schedules), len(specs))
+	}
+}
+
+func TestParseSchedulesInvalid(t *testing.T) {
+	_, err := parseSchedules([]string{"not a cron expression"})
+	if err == nil {
+		t.Fatal("parseSchedules with an invalid entry should return an error")
+	}
+}
+
+func TestNextFireTimeSoonestOfMultiple(t *testing.T) {
+	// Every day at 01:00 and every day at 02:00; from 00:00 the 01:00 entry
+	// should fire first.
+	schedules, err := parseSchedules([]string{"0 1 * * *", "0 2 * * *"})
+	if err != nil {
+		t.Fatalf("parseSchedules returned error: %v", err)
+	}
+
+	from := time.Date(2026, 7, 25, 0, 0, 0, 0, time.UTC)
+	next, ok := nextFireTime(schedules, from)
+	if !ok {
+		t.Fatal("nextFireTime() returned ok = false for a non-empty schedule list")
+	}
+
+	want := time.Date(2026, 7, 25, 1, 0, 0, 0, time.UTC)
+	if !next.Equal(want) {
+		t.Fatalf("nextFireTime() = %v, want %v", next, want)
+	}
+}
+
+func TestNextFireTimeDefaultSundaySchedule(t *testing.T) {
+	schedules, err := parseSchedules([]string{"0 23 * * SUN"})
+	if err != nil {
+		t.Fatalf("parseSchedules returned error: %v", err)
+	}
+
+	// 2026-07-25 is a Saturday; the next Sunday 23:00 is 2026-07-26.
+	from := time.Date(2026, 7, 25, 12, 0, 0, 0, time.UTC)
+	next, ok := nextFireTime(schedules, from)
+	if !ok {
+		t.Fatal("nextFireTime() returned ok = false for a non-empty schedule list")
+	}
+
+	want := time.Date(2026, 7, 26, 23, 0, 0, 0, time.UTC)
+	if !next.Equal(want) {
+		t.Fatalf("nextFireTime() = %v, want %v", next, want)
+	}
+}
+
+func TestNextFireTimeEmptySchedules(t *testing.T) {
+	// An empty schedule list (e.g. config.yaml's "schedules: []") must not
+	// report a fire time at all, since the zero time.Time it would
+	// otherwise return is already in the past and would reboot-loop the
+	// service immediately.
+	from := time.Date(2026, 7, 25, 12, 0, 0, 0, time.UTC)
+	next, ok := nextFireTime(nil, from)
+	if ok {
+		t.Fatalf("nextFireTime(nil, ...) = %v, ok = true; want ok = false", next)
+	}
+}
+
+func TestConfigModTime(t *testing.T) {
+	dir := t.TempDir()
+	oldExePath := exePath
+	exePath = dir + string(os.PathSeparator)
+	defer func() { exePath = oldExePath }()
+
+	if _, err := os.Stat(configPath()); !os.IsNotExist(err) {
+		t.Fatalf("expected config.yaml not to exist yet in %s", dir)
+	}
+	if mod := configModTime(); !mod.IsZero() {
+		t.Fatalf("configModTime() on a missing file = %v, want zero value", mod)
+	}
+
+	if err := os.WriteFile(configPath(), []byte("schedules: []\n"), 0644); err != nil {
+		t.Fatalf("failed to write config.yaml: %v", err)
+	}
+
+	info, err := os.Stat(configPath())
+	if err != nil {
+		t.Fatalf("failed to stat config.yaml: %v", err)
+	}
+	if mod := configModTime(); !mod.Equal(info.ModTime()) {
+		t.Fatalf("configModTime() = %v, want %v", mod, info.ModTime())
+	}
+}